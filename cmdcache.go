@@ -0,0 +1,62 @@
+// Copyright (C) 2018 Michael Picht
+//
+// This file is part of gool (Online TV Recorder on Linux in Go).
+//
+// gool is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// gool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with gool. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+// cmdcache.go adds the "gool cache" command family, which lets users
+// inspect and evict entries of the on-disk cutlist cache (see
+// cutlistcache.go) without having to reach into the config dir by hand.
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the local cutlist cache",
+	Long:  "cache lets you inspect and evict entries of gool's on-disk cutlist cache.",
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove cutlist header entries older than the configured TTL",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return clCache().prune()
+	},
+}
+
+var cacheListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List entries of the cutlist cache",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return clCache().list()
+	},
+}
+
+var cacheVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify the integrity of all cutlist cache entries",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return clCache().verify()
+	},
+}
+
+func init() {
+	cacheCmd.AddCommand(cachePruneCmd, cacheListCmd, cacheVerifyCmd)
+	rootCmd.AddCommand(cacheCmd)
+	rootCmd.PersistentFlags().BoolVar(&cfg.offline, "offline", false, "operate purely from the local cutlist cache, without making any network calls")
+}
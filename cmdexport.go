@@ -0,0 +1,89 @@
+// Copyright (C) 2018 Michael Picht
+//
+// This file is part of gool (Online TV Recorder on Linux in Go).
+//
+// gool is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// gool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with gool. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+// cmdexport.go adds the "gool export" command, which fetches the
+// best-rated cutlist for a video and writes it out in one of the formats
+// implemented by export.go.
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportFormatFlag string
+	exportOutputFlag string
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export <video>",
+	Short: "Export a fetched cutlist to an external format",
+	Long: "export fetches the best-rated cutlist for <video> (the same key used by " +
+		"'gool cut') and writes its cuts to stdout (or --output) in the format " +
+		"given by --format, so they can be applied in other editors such as " +
+		"kdenlive or Avidemux, or previewed in mpv.",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key := args[0]
+
+		format := exportFormat(exportFormatFlag)
+		switch format {
+		case exportFormatEDL, exportFormatConcat, exportFormatMpvEDL:
+		default:
+			return fmt.Errorf("unknown export format '%s' (want edl, concat or mpv-edl)", exportFormatFlag)
+		}
+
+		p, err := clProvider()
+		if err != nil {
+			return err
+		}
+		clhs, err := p.ListHeaders(key)
+		if err != nil {
+			return err
+		}
+		if len(clhs) == 0 {
+			return fmt.Errorf("no cutlist found for '%s'", key)
+		}
+
+		cl, err := p.FetchDetails(clhs[0].id)
+		if err != nil {
+			return err
+		}
+
+		out := os.Stdout
+		if exportOutputFlag != "" {
+			f, err := os.Create(exportOutputFlag)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+
+		return export(cl, key, format, out)
+	},
+}
+
+func init() {
+	exportCmd.Flags().StringVar(&exportFormatFlag, "format", string(exportFormatEDL), "export format: edl, concat or mpv-edl")
+	exportCmd.Flags().StringVar(&exportOutputFlag, "output", "", "write to this file instead of stdout")
+	rootCmd.AddCommand(exportCmd)
+}
@@ -0,0 +1,99 @@
+// Copyright (C) 2018 Michael Picht
+//
+// This file is part of gool (Online TV Recorder on Linux in Go).
+//
+// gool is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// gool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with gool. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+// cmdsubmit.go adds the "gool submit" command, which reads a locally
+// edited cutlist file and uploads it to cutlist.at via SubmitCutlist (see
+// cutlistprovider.go and cutlistat.Provider.Submit).
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mipimipi/gool/cutlistat"
+)
+
+var (
+	submitIDFlag      string
+	submitRatingFlag  int
+	submitAuthorFlag  string
+	submitCommentFlag string
+	submitDryRunFlag  bool
+)
+
+var submitCmd = &cobra.Command{
+	Use:   "submit <video> <cutlist-file>",
+	Short: "Upload a locally edited cutlist to cutlist.at",
+	Long: "submit reads a cutlist file in cutlist.at's INI schema (e.g. one " +
+		"previously fetched and then edited by hand) and uploads it to the " +
+		"configured cutlist.at server for <video>. --dry-run runs the same " +
+		"render/re-parse round-trip check Submit performs before uploading, " +
+		"and reports whether it would be accepted, without uploading it.",
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key, path := args[0], args[1]
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("cannot read cutlist file '%s': %v", path, err)
+		}
+
+		id := submitIDFlag
+		if id == "" {
+			id = key
+		}
+		clAt, err := cutlistat.ParseCutlist(id, data)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a valid cutlist file: %v", path, err)
+		}
+
+		if submitDryRunFlag {
+			// run the same render -> re-parse round-trip check Submit does,
+			// so --dry-run actually validates what would be uploaded
+			if _, err := cutlistat.ValidateCutlist(clAt); err != nil {
+				return fmt.Errorf("'%s' would be rejected on submission: %v", path, err)
+			}
+			fmt.Printf("'%s' is a valid cutlist with %d cut(s), it would be submitted for '%s'\n", path, len(clAt.Segs), key)
+			return nil
+		}
+
+		meta := SubmitMeta{
+			VideoKey: key,
+			Rating:   submitRatingFlag,
+			Author:   submitAuthorFlag,
+			Comment:  submitCommentFlag,
+		}
+		if err := SubmitCutlist(fromCutlistatCutlist(clAt), meta); err != nil {
+			return fmt.Errorf("cannot submit cutlist: %v", err)
+		}
+
+		fmt.Printf("Cutlist '%s' submitted for '%s'\n", path, key)
+		return nil
+	},
+}
+
+func init() {
+	submitCmd.Flags().StringVar(&submitIDFlag, "id", "", "cutlist ID to submit as (defaults to <video>)")
+	submitCmd.Flags().IntVar(&submitRatingFlag, "rating", 0, "rating to submit, 1 (worst) to 5 (best)")
+	submitCmd.Flags().StringVar(&submitAuthorFlag, "author", "", "author name to submit")
+	submitCmd.Flags().StringVar(&submitCommentFlag, "comment", "", "comment to submit")
+	submitCmd.Flags().BoolVar(&submitDryRunFlag, "dry-run", false, "validate the cutlist file without uploading it")
+	rootCmd.AddCommand(submitCmd)
+}
@@ -0,0 +1,512 @@
+// Copyright (C) 2018 Michael Picht
+//
+// This file is part of gool (Online TV Recorder on Linux in Go).
+//
+// gool is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// gool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with gool. If not, see <http://www.gnu.org/licenses/>.
+
+// Package cutlistat implements retrieval of cutlist headers and cutlist
+// details from a cutlist.at-compatible server (own instance, mirror or
+// private cut server). It knows nothing about gool's video pipeline -
+// callers adapt its types to whatever they need.
+package cutlistat
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-ini/ini"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/html/charset"
+)
+
+// Header is the header information of a cutlist as returned by a
+// cutlist.at-compatible server's getxml.php endpoint.
+type Header struct {
+	ID    string
+	Score float64
+}
+
+// Seg is one cut of a Cutlist.
+type Seg struct {
+	TimeStart  float64 // start time (in seconds)
+	TimeDur    float64 // duration (time in seconds)
+	FrameStart int     // start frame (frame number)
+	FrameDur   int     // duration (number of frames)
+}
+
+// Cutlist is a cutlist as retrieved from a cutlist.at-compatible server's
+// getfile.php endpoint.
+type Cutlist struct {
+	ID         string
+	App        string
+	Ratio      string
+	FPS        float64
+	TimeBased  bool
+	FrameBased bool
+	Segs       []*Seg
+}
+
+// Cache lets a Provider keep the raw responses it gets from the cutlist
+// server around, so they can be replayed without hitting the network again.
+// It is consulted before every request and updated after every successful
+// one; whether and how long an entry stays valid is entirely up to the
+// implementation (e.g. a TTL for headers, since those can change as new
+// cutlists are rated, vs. cutlist details, which don't change once
+// published).
+type Cache interface {
+	GetHeaders(key string) ([]byte, bool)
+	PutHeaders(key string, data []byte)
+	GetDetails(id string) ([]byte, bool)
+	PutDetails(id string, data []byte)
+}
+
+// Provider retrieves cutlist headers and cutlists from one cutlist.at-
+// compatible server, identified by URL.
+type Provider struct {
+	URL string
+
+	// Cache is consulted before any network call, if set.
+	Cache Cache
+	// Offline forces Provider to serve exclusively from Cache; it returns
+	// an error instead of making any network call on a cache miss.
+	Offline bool
+}
+
+// New creates a Provider for the cutlist server reachable at url. url must
+// have a trailing slash, as required by getxml.php/getfile.php.
+func New(url string) *Provider {
+	return &Provider{URL: url}
+}
+
+// ListHeaders requests the cutlist header information for key (i.e. for a
+// video) from the cutlist server, or from the Cache if it already has it.
+// It returns the headers unsorted, in the order the source sent them in.
+func (p *Provider) ListHeaders(key string) ([]Header, error) {
+	var (
+		hds   []Header
+		hd    Header
+		resp  *http.Response
+		err   error
+		clXML []byte
+		el    string
+	)
+
+	// constants for relevant element names of cutlist headers
+	const (
+		clTagID      = "ID"
+		clTagRating  = "RATING"
+		clTagCutlist = "CUTLIST"
+	)
+
+	// array of relevant element names
+	clRelNames := [...]string{clTagID, clTagRating}
+	// map to store values of relevant element values for one cutlist
+	var clRelVals map[string]string
+
+	// try the cache first
+	if p.Cache != nil {
+		if data, ok := p.Cache.GetHeaders(key); ok {
+			clXML = data
+		}
+	}
+
+	if clXML == nil {
+		if p.Offline {
+			return nil, fmt.Errorf("offline mode: no cached cutlist headers for '%s'", key)
+		}
+
+		log.Debugf("Call cutlist server: %sgetxml.php?name=%s", p.URL, key)
+
+		// load cutlist header from cutlist server by calling URL
+		if resp, err = http.Get(p.URL + "getxml.php?name=" + key); err != nil {
+			return nil, fmt.Errorf("cannot retrieve cutlist headers from '%s': %v", p.URL, err)
+		}
+
+		// read data
+		clXML, err = ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read XML body from '%s': %v", p.URL, err)
+		}
+
+		if p.Cache != nil {
+			p.Cache.PutHeaders(key, clXML)
+		}
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(clXML))
+	dec.CharsetReader = charset.NewReaderLabel
+	// FROM: https://stackoverflow.com/questions/6002619/unmarshal-an-iso-8859-1-xml-input-in-go#32224438
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("error while reading cutlist headers from '%s': %v", p.URL, err)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			// if element is in list of relevant elements ...
+			for _, s := range clRelNames {
+				if strings.ToUpper(tok.Name.Local) == s {
+					// ... store element name in el
+					el = strings.ToUpper(tok.Name.Local)
+					break
+				}
+			}
+			// if new cutlists start ...
+			if strings.ToUpper(tok.Name.Local) == clTagCutlist {
+				// create new map to store the relevant values
+				clRelVals = make(map[string]string)
+			}
+		case xml.EndElement:
+			// if a relevant element ends ...
+			if strings.ToUpper(tok.Name.Local) == el {
+				// clear el
+				el = ""
+			}
+			// if the end of a cutlist has been reached ...
+			if strings.ToUpper(tok.Name.Local) == clTagCutlist {
+				// fill header struct ...
+				hd.ID = clRelVals[clTagID]
+				hd.Score, _ = strconv.ParseFloat(clRelVals[clTagRating], 64)
+				// and append it to the header list
+				if hd.ID != "" {
+					hds = append(hds, hd)
+				}
+			}
+		case xml.CharData:
+			// if element is relevant ...
+			if el != "" {
+				// store value for later processing
+				clRelVals[el] = string(tok)
+			}
+		}
+	}
+
+	return hds, nil
+}
+
+// constants for cl INI file sections and keys, as looked up by
+// parseCutlistINI (which loads case-insensitively, hence lower case).
+// renderCutlistINI writes the same names in cutlist.at's capitalisation.
+const (
+	clSectionGeneral = "general"
+	clKeyNumCuts     = "noofcuts"
+	clKeyRatio       = "displayaspectratio"
+	clKeyApp         = "intendedcutapplicationname"
+	clKeyFPS         = "framespersecond"
+	clSectionCut     = "cut"
+	clKeyTimeStart   = "start"
+	clKeyTimeDur     = "duration"
+	clKeyFrameStart  = "startframe"
+	clKeyFrameDur    = "durationframes"
+)
+
+// FetchDetails retrieves the cutlist with id from the cutlist server, or
+// from the Cache if it already has it.
+func (p *Provider) FetchDetails(id string) (*Cutlist, error) {
+	var (
+		resp  *http.Response
+		clINI []byte
+		err   error
+	)
+
+	// try the cache first; cutlists don't change once published, so a cache
+	// hit is always used regardless of age
+	if p.Cache != nil {
+		if data, ok := p.Cache.GetDetails(id); ok {
+			clINI = data
+		}
+	}
+
+	if clINI == nil {
+		if p.Offline {
+			return nil, fmt.Errorf("offline mode: no cached cutlist for ID=%s", id)
+		}
+
+		// load cutlist from the cutlist server by calling URL
+		if resp, err = http.Get(p.URL + "getfile.php?id=" + id); err != nil {
+			return nil, fmt.Errorf("cannot retrieve cutlist ID=%s from '%s': %v", id, p.URL, err)
+		}
+		// read data
+		clINI, err = ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read cutlist ID=%s from '%s': %v", id, p.URL, err)
+		}
+
+		if p.Cache != nil {
+			p.Cache.PutDetails(id, clINI)
+		}
+	}
+
+	return parseCutlistINI(id, clINI)
+}
+
+// ParseCutlist parses data, which must follow the cutlist.at INI schema
+// (as returned by getfile.php, or produced by hand/another tool), into a
+// Cutlist with the given id. It is exported so callers can load a locally
+// edited cutlist file before submitting it.
+func ParseCutlist(id string, data []byte) (*Cutlist, error) {
+	return parseCutlistINI(id, data)
+}
+
+// parseCutlistINI parses the cutlist.at INI schema (as returned by
+// getfile.php, and expected by postfile.php) into a Cutlist. It is also
+// used by Submit's dry-run validation, to verify that a rendered Cutlist
+// round-trips back to the same data.
+func parseCutlistINI(id string, clINI []byte) (*Cutlist, error) {
+	var (
+		clFile  *ini.File
+		sec     *ini.Section
+		key     *ini.Key
+		numCuts int
+		sg      *Seg
+		err     error
+	)
+
+	cl := &Cutlist{ID: id}
+
+	// open cutlist INI data source with go-ini
+	if clFile, err = ini.InsensitiveLoad(clINI); err != nil {
+		return nil, fmt.Errorf("cutlist file could not be opened for ID '%s': %v", id, err)
+	}
+
+	// get GENERAL section
+	if sec, err = clFile.GetSection(clSectionGeneral); err != nil {
+		return nil, fmt.Errorf("cutlist ID=%s does not have section '%s': %v", id, clSectionGeneral, err)
+	}
+
+	// get display aspect ratio
+	if key, err = sec.GetKey(clKeyRatio); err != nil {
+		log.Warnf("Cutlist ID=%s does not have key '%s'", id, clKeyRatio)
+	} else {
+		cl.Ratio = key.Value()
+	}
+
+	// get frames per second
+	if key, err = sec.GetKey(clKeyFPS); err != nil {
+		log.Warnf("Cutlist ID=%s does not have key '%s'", id, clKeyFPS)
+	} else {
+		cl.FPS, _ = strconv.ParseFloat(key.Value(), 64)
+	}
+
+	// get intended cut application
+	if key, err = sec.GetKey(clKeyApp); err != nil {
+		log.Warnf("Cutlist ID=%s does not have key '%s'", id, clKeyApp)
+	} else {
+		cl.App = key.Value()
+	}
+
+	// get number of cuts
+	if key, err = sec.GetKey(clKeyNumCuts); err != nil {
+		return nil, fmt.Errorf("cutlist ID=%s does not have key '%s': %v", id, clKeyNumCuts, err)
+	}
+	numCuts, _ = strconv.Atoi(key.Value())
+
+	// read cuts
+	for i := 0; i < numCuts; i++ {
+		// get [Cut{i}] section
+		if sec, err = clFile.GetSection(clSectionCut + strconv.Itoa(i)); err != nil {
+			return nil, fmt.Errorf("cutlist ID=%s does not have section '%s': %v", id, clSectionCut+strconv.Itoa(i), err)
+		}
+		sg = new(Seg)
+		// get start time
+		if sec.HasKey(clKeyTimeStart) {
+			key, _ = sec.GetKey(clKeyTimeStart)
+			if i == 0 {
+				cl.TimeBased = true
+			}
+			sg.TimeStart, _ = strconv.ParseFloat(key.Value(), 64)
+		}
+		// get time duration
+		if sec.HasKey(clKeyTimeDur) {
+			key, _ = sec.GetKey(clKeyTimeDur)
+			sg.TimeDur, _ = strconv.ParseFloat(key.Value(), 64)
+		}
+		// get start frame
+		if sec.HasKey(clKeyFrameStart) {
+			key, _ = sec.GetKey(clKeyFrameStart)
+			if i == 0 {
+				cl.FrameBased = true
+			}
+			sg.FrameStart, _ = strconv.Atoi(key.Value())
+		}
+		// get frames duration
+		if sec.HasKey(clKeyFrameDur) {
+			key, _ = sec.GetKey(clKeyFrameDur)
+			sg.FrameDur, _ = strconv.Atoi(key.Value())
+		}
+
+		// consistency checks:
+		// - verify that all cuts have frame information (if the first one had)
+		if cl.FrameBased && (sg.FrameStart == 0 && sg.FrameDur == 0) {
+			return nil, fmt.Errorf("cutlist ID=%s: cut %s is missing frame information", id, clSectionCut+strconv.Itoa(i))
+		}
+		// - verify that all cuts have time information (if the first one had)
+		if cl.TimeBased && (sg.TimeStart == 0 && sg.TimeDur == 0) {
+			return nil, fmt.Errorf("cutlist ID=%s: cut %s is missing time information", id, clSectionCut+strconv.Itoa(i))
+		}
+		// - verify the all cuts have either frame or time information or both
+		if (sg.TimeStart == 0.0 && sg.TimeDur == 0.0) && (sg.FrameStart == 0 && sg.FrameDur == 0) {
+			return nil, fmt.Errorf("cutlist ID=%s: cut %s does not have sufficient information", id, clSectionCut+strconv.Itoa(i))
+		}
+
+		cl.Segs = append(cl.Segs, sg)
+	}
+
+	if len(cl.Segs) == 0 {
+		return nil, fmt.Errorf("cutlist ID=%s does not have any cuts", id)
+	}
+
+	return cl, nil
+}
+
+// renderCutlistINI renders cl back to the cutlist.at INI schema, inverting
+// parseCutlistINI: a [General] section followed by [Cut0]...[CutN]
+// sections with time and/or frame keys, depending on cl.TimeBased and
+// cl.FrameBased.
+func renderCutlistINI(cl *Cutlist) ([]byte, error) {
+	clFile := ini.Empty()
+
+	gen, err := clFile.NewSection("General")
+	if err != nil {
+		return nil, err
+	}
+	gen.NewKey("NoOfCuts", strconv.Itoa(len(cl.Segs)))
+	gen.NewKey("DisplayAspectRatio", cl.Ratio)
+	gen.NewKey("IntendedCutApplicationName", cl.App)
+	gen.NewKey("FramesPerSecond", strconv.FormatFloat(cl.FPS, 'f', -1, 64))
+
+	for i, sg := range cl.Segs {
+		sec, err := clFile.NewSection("Cut" + strconv.Itoa(i))
+		if err != nil {
+			return nil, err
+		}
+		if cl.TimeBased {
+			sec.NewKey("Start", strconv.FormatFloat(sg.TimeStart, 'f', -1, 64))
+			sec.NewKey("Duration", strconv.FormatFloat(sg.TimeDur, 'f', -1, 64))
+		}
+		if cl.FrameBased {
+			sec.NewKey("StartFrame", strconv.Itoa(sg.FrameStart))
+			sec.NewKey("DurationFrames", strconv.Itoa(sg.FrameDur))
+		}
+	}
+
+	var buf bytes.Buffer
+	if _, err := clFile.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ValidateCutlist renders cl to the cutlist.at INI schema and re-parses the
+// result, to make sure it round-trips to an equivalent Cutlist before it is
+// submitted. It returns the rendered INI on success. This is the same
+// check Submit performs before POSTing; it is exported so callers (e.g. a
+// "submit --dry-run") can run it without making a network call.
+func ValidateCutlist(cl *Cutlist) ([]byte, error) {
+	clINI, err := renderCutlistINI(cl)
+	if err != nil {
+		return nil, fmt.Errorf("cannot render cutlist: %v", err)
+	}
+
+	got, err := parseCutlistINI(cl.ID, clINI)
+	if err != nil {
+		return nil, fmt.Errorf("rendered cutlist does not round-trip: %v", err)
+	}
+	if got.Ratio != cl.Ratio || got.App != cl.App || got.FPS != cl.FPS ||
+		got.TimeBased != cl.TimeBased || got.FrameBased != cl.FrameBased || len(got.Segs) != len(cl.Segs) {
+		return nil, fmt.Errorf("rendered cutlist does not round-trip: general information differs")
+	}
+	for i, sg := range got.Segs {
+		if *sg != *cl.Segs[i] {
+			return nil, fmt.Errorf("rendered cutlist does not round-trip: cut %d differs", i)
+		}
+	}
+
+	return clINI, nil
+}
+
+// SubmitMeta carries the metadata a user supplies when submitting an
+// edited cutlist back to the server.
+type SubmitMeta struct {
+	VideoKey string // key of the video the cutlist belongs to
+	Rating   int    // 1 (worst) .. 5 (best), as used by cutlist.at
+	Author   string
+	Comment  string
+	Token    string // the user's API token
+}
+
+// Submit renders cl to the cutlist.at INI schema and POSTs it, together
+// with meta, to postfile.php on the server. Before POSTing, the rendered
+// INI is re-parsed to make sure it round-trips to an equivalent Cutlist -
+// if it doesn't, something in cl can't be expressed in the INI schema and
+// Submit fails without making a network call.
+func (p *Provider) Submit(cl *Cutlist, meta SubmitMeta) error {
+	clINI, err := ValidateCutlist(cl)
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for field, val := range map[string]string{
+		"name":    meta.VideoKey,
+		"token":   meta.Token,
+		"rating":  strconv.Itoa(meta.Rating),
+		"author":  meta.Author,
+		"comment": meta.Comment,
+	} {
+		if err := mw.WriteField(field, val); err != nil {
+			return fmt.Errorf("cannot build submission request: %v", err)
+		}
+	}
+	fw, err := mw.CreateFormFile("cutfile", cl.ID+".ini")
+	if err != nil {
+		return fmt.Errorf("cannot build submission request: %v", err)
+	}
+	if _, err := fw.Write(clINI); err != nil {
+		return fmt.Errorf("cannot build submission request: %v", err)
+	}
+	if err := mw.Close(); err != nil {
+		return fmt.Errorf("cannot build submission request: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.URL+"postfile.php", &body)
+	if err != nil {
+		return fmt.Errorf("cannot build submission request: %v", err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot submit cutlist to '%s': %v", p.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cutlist server rejected submission: HTTP %s", resp.Status)
+	}
+
+	return nil
+}
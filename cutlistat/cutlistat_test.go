@@ -0,0 +1,103 @@
+// Copyright (C) 2018 Michael Picht
+//
+// This file is part of gool (Online TV Recorder on Linux in Go).
+//
+// gool is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// gool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with gool. If not, see <http://www.gnu.org/licenses/>.
+
+package cutlistat
+
+import "testing"
+
+func TestValidateCutlistTimeBasedRoundTrips(t *testing.T) {
+	cl := &Cutlist{
+		ID:        "42",
+		App:       "gool-test",
+		Ratio:     "16:9",
+		FPS:       25,
+		TimeBased: true,
+		Segs: []*Seg{
+			{TimeStart: 0, TimeDur: 10.5},
+			{TimeStart: 20, TimeDur: 5},
+		},
+	}
+
+	clINI, err := ValidateCutlist(cl)
+	if err != nil {
+		t.Fatalf("ValidateCutlist: %v", err)
+	}
+
+	got, err := ParseCutlist(cl.ID, clINI)
+	if err != nil {
+		t.Fatalf("ParseCutlist on rendered INI: %v", err)
+	}
+
+	if got.Ratio != cl.Ratio || got.App != cl.App || got.FPS != cl.FPS || !got.TimeBased || got.FrameBased {
+		t.Fatalf("round-tripped cutlist metadata = %+v, want equivalent of %+v", got, cl)
+	}
+	if len(got.Segs) != len(cl.Segs) {
+		t.Fatalf("round-tripped cutlist has %d segs, want %d", len(got.Segs), len(cl.Segs))
+	}
+	for i, sg := range got.Segs {
+		if sg.TimeStart != cl.Segs[i].TimeStart || sg.TimeDur != cl.Segs[i].TimeDur {
+			t.Errorf("seg %d = %+v, want %+v", i, sg, cl.Segs[i])
+		}
+	}
+}
+
+func TestValidateCutlistFrameBasedRoundTrips(t *testing.T) {
+	cl := &Cutlist{
+		ID:         "43",
+		FPS:        25,
+		FrameBased: true,
+		Segs: []*Seg{
+			{FrameStart: 0, FrameDur: 250},
+			{FrameStart: 500, FrameDur: 125},
+		},
+	}
+
+	clINI, err := ValidateCutlist(cl)
+	if err != nil {
+		t.Fatalf("ValidateCutlist: %v", err)
+	}
+
+	got, err := ParseCutlist(cl.ID, clINI)
+	if err != nil {
+		t.Fatalf("ParseCutlist on rendered INI: %v", err)
+	}
+
+	if !got.FrameBased || got.TimeBased {
+		t.Fatalf("round-tripped cutlist = %+v, want FrameBased only", got)
+	}
+	for i, sg := range got.Segs {
+		if sg.FrameStart != cl.Segs[i].FrameStart || sg.FrameDur != cl.Segs[i].FrameDur {
+			t.Errorf("seg %d = %+v, want %+v", i, sg, cl.Segs[i])
+		}
+	}
+}
+
+func TestValidateCutlistRejectsEmptyCutlist(t *testing.T) {
+	cl := &Cutlist{ID: "44", TimeBased: true}
+
+	if _, err := ValidateCutlist(cl); err == nil {
+		t.Fatal("ValidateCutlist accepted a cutlist with no cuts")
+	}
+}
+
+func TestParseCutlistRejectsMissingNumCuts(t *testing.T) {
+	data := []byte("[General]\ndisplayaspectratio=16:9\n")
+
+	if _, err := ParseCutlist("45", data); err == nil {
+		t.Fatal("ParseCutlist accepted an INI file without a noofcuts key")
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright (C) 2018 Michael Picht
+//
+// This file is part of gool (Online TV Recorder on Linux in Go).
+//
+// gool is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// gool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with gool. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+// cutlistcache.go implements a persistent, content-addressed on-disk cache
+// for the raw responses a CutlistProvider gets from a cutlist server. It
+// lets previously downloaded material be re-cut without hitting the
+// network again, and backs the --offline flag.
+//
+// Entries are addressed by a hash of the video key / cutlist ID rather
+// than by the value itself, both to keep the cache scoped per provider
+// (cutlistCache.forProvider) without worrying about characters that don't
+// round-trip through a directory name, and to keep a key/id coming
+// straight from a CLI argument or a remote server's XML response from
+// being able to escape the cache directory.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// sub-directories/suffixes of the cache dir
+const (
+	clCacheHeadersDir = "headers"
+	clCacheDetailsDir = "cuts"
+	clCacheSumSuffix  = ".sha256"
+	clCacheNameSuffix = ".name"
+)
+
+// cutlistCache is a persistent on-disk cache for raw cutlist server
+// responses, stored under <config dir>/cache/cutlists/<provider>. It
+// implements cutlistat.Cache.
+type cutlistCache struct {
+	dir     string
+	ttl     time.Duration // max age of a header entry; 0 means "never expires"
+	offline bool          // if true, headers are served regardless of age
+}
+
+// newCutlistCache creates a cutlistCache rooted at dir.
+func newCutlistCache(dir string, ttl time.Duration, offline bool) *cutlistCache {
+	return &cutlistCache{dir: dir, ttl: ttl, offline: offline}
+}
+
+// clCache builds the cutlistCache for the currently configured cache dir,
+// TTL and offline mode. It is not provider-specific yet - callers must go
+// through forProvider before handing it to a CutlistProvider, so that two
+// providers never share a cache slot.
+func clCache() *cutlistCache {
+	return newCutlistCache(filepath.Join(cfg.confDir, "cache", "cutlists"), cfg.clCacheTTL, cfg.offline)
+}
+
+// forProvider returns the sub-cache to use for pc. Every provider gets its
+// own directory, named after a hash of its type and URL, so that e.g. two
+// mirrors that happen to assign the same cutlist ID to different content
+// don't clobber each other's cache entries.
+func (c *cutlistCache) forProvider(pc ProviderConfig) *cutlistCache {
+	return &cutlistCache{
+		dir:     filepath.Join(c.dir, cacheName(pc.Type+"|"+pc.URL)),
+		ttl:     c.ttl,
+		offline: c.offline,
+	}
+}
+
+// cacheName turns an arbitrary string (a video key, a cutlist ID, or a
+// provider's type+URL) into a fixed-length, filesystem-safe name, so it
+// can be used as a file/directory name regardless of what characters (or
+// path traversal sequences) the original string contains.
+func cacheName(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *cutlistCache) headersFile(key string) string {
+	return filepath.Join(c.dir, clCacheHeadersDir, cacheName(key)+".xml")
+}
+
+func (c *cutlistCache) detailsFile(id string) string {
+	return filepath.Join(c.dir, clCacheDetailsDir, cacheName(id)+".ini")
+}
+
+// GetHeaders returns the cached raw header XML for key, unless it is older
+// than the configured TTL (ignored in offline mode) or fails its integrity
+// check.
+func (c *cutlistCache) GetHeaders(key string) ([]byte, bool) {
+	return c.get(c.headersFile(key), c.ttl, c.offline)
+}
+
+// PutHeaders stores the raw header XML for key, alongside a SHA-256 checksum.
+func (c *cutlistCache) PutHeaders(key string, data []byte) {
+	if err := c.put(c.headersFile(key), key, data); err != nil {
+		log.WithFields(log.Fields{"key": key}).Warnf("Cannot write cutlist header cache entry: %v", err)
+	}
+}
+
+// GetDetails returns the cached raw INI cutlist for id. Cutlists don't
+// change once published, so entries never expire.
+func (c *cutlistCache) GetDetails(id string) ([]byte, bool) {
+	return c.get(c.detailsFile(id), 0, true)
+}
+
+// PutDetails stores the raw INI cutlist for id, alongside a SHA-256 checksum.
+func (c *cutlistCache) PutDetails(id string, data []byte) {
+	if err := c.put(c.detailsFile(id), id, data); err != nil {
+		log.Warnf("Cannot write cutlist cache entry for ID=%s: %v", id, err)
+	}
+}
+
+// get reads p, honoring ttl (unless ignoreTTL is set) and verifying the
+// entry against its checksum file.
+func (c *cutlistCache) get(p string, ttl time.Duration, ignoreTTL bool) ([]byte, bool) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, false
+	}
+	if !ignoreTTL && ttl > 0 && time.Since(info.ModTime()) > ttl {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, false
+	}
+	if !checksumMatches(p, data) {
+		log.Warnf("Cutlist cache entry '%s' failed its integrity check, ignoring it", p)
+		return nil, false
+	}
+	return data, true
+}
+
+// put writes data to p, records its SHA-256 checksum next to it, and keeps
+// the un-hashed name (key or id) around in a sidecar file, purely so
+// "gool cache list" can show something more useful than a hash.
+func (c *cutlistCache) put(p, name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(p, data, 0644); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(p+clCacheSumSuffix, []byte(checksum(data)), 0644); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p+clCacheNameSuffix, []byte(name), 0644)
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func checksumMatches(p string, data []byte) bool {
+	want, err := ioutil.ReadFile(p + clCacheSumSuffix)
+	if err != nil {
+		// no checksum file next to it: treat as untrusted
+		return false
+	}
+	return string(want) == checksum(data)
+}
+
+// entries lists the cache entries in every directory named sub
+// (clCacheHeadersDir or clCacheDetailsDir) below c.dir, skipping checksum
+// and name sidecar files. For the cache returned by clCache, this covers
+// the per-provider sub-caches created by forProvider.
+func (c *cutlistCache) entries(sub string) ([]string, error) {
+	var paths []string
+	err := filepath.Walk(c.dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || filepath.Base(filepath.Dir(p)) != sub || filepath.Ext(p) == clCacheSumSuffix || filepath.Ext(p) == clCacheNameSuffix {
+			return nil
+		}
+		paths = append(paths, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// displayName returns the original key/id stored alongside p, falling
+// back to p's (hashed) base name if no sidecar is present.
+func displayName(p string) string {
+	name, err := ioutil.ReadFile(p + clCacheNameSuffix)
+	if err != nil {
+		return filepath.Base(p)
+	}
+	return string(name)
+}
+
+// prune removes header entries older than the configured TTL. Cutlist
+// details are kept indefinitely, since they never go stale.
+func (c *cutlistCache) prune() error {
+	if c.ttl <= 0 {
+		log.Info("No cutlist header TTL configured, nothing to prune")
+		return nil
+	}
+	paths, err := c.entries(clCacheHeadersDir)
+	if err != nil {
+		return err
+	}
+	var pruned int
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		if time.Since(info.ModTime()) <= c.ttl {
+			continue
+		}
+		if err := os.Remove(p); err != nil {
+			log.Warnf("Cannot remove stale cutlist cache entry '%s': %v", p, err)
+			continue
+		}
+		_ = os.Remove(p + clCacheSumSuffix)
+		_ = os.Remove(p + clCacheNameSuffix)
+		pruned++
+	}
+	log.Infof("Pruned %d stale cutlist header cache entries", pruned)
+	return nil
+}
+
+// list prints all cache entries with their size and age.
+func (c *cutlistCache) list() error {
+	for _, sub := range []string{clCacheHeadersDir, clCacheDetailsDir} {
+		paths, err := c.entries(sub)
+		if err != nil {
+			return err
+		}
+		for _, p := range paths {
+			info, err := os.Stat(p)
+			if err != nil {
+				continue
+			}
+			fmt.Printf("%-8s %-40s %8d bytes  age %s\n", sub, displayName(p), info.Size(), time.Since(info.ModTime()).Round(time.Second))
+		}
+	}
+	return nil
+}
+
+// verify re-checks the SHA-256 checksum of every cache entry and reports
+// any that fail.
+func (c *cutlistCache) verify() error {
+	var bad int
+	for _, sub := range []string{clCacheHeadersDir, clCacheDetailsDir} {
+		paths, err := c.entries(sub)
+		if err != nil {
+			return err
+		}
+		for _, p := range paths {
+			data, err := ioutil.ReadFile(p)
+			if err != nil {
+				fmt.Printf("%-40s UNREADABLE: %v\n", displayName(p), err)
+				bad++
+				continue
+			}
+			if !checksumMatches(p, data) {
+				fmt.Printf("%-40s FAILED\n", displayName(p))
+				bad++
+				continue
+			}
+			fmt.Printf("%-40s OK\n", displayName(p))
+		}
+	}
+	if bad > 0 {
+		return fmt.Errorf("%d cache entries failed verification", bad)
+	}
+	return nil
+}
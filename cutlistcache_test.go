@@ -0,0 +1,215 @@
+// Copyright (C) 2018 Michael Picht
+//
+// This file is part of gool (Online TV Recorder on Linux in Go).
+//
+// gool is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// gool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with gool. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCutlistCacheHeadersRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gool-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := newCutlistCache(dir, time.Hour, false)
+
+	if _, ok := c.GetHeaders("some-key"); ok {
+		t.Fatal("GetHeaders found an entry that was never put")
+	}
+
+	c.PutHeaders("some-key", []byte("<xml/>"))
+
+	data, ok := c.GetHeaders("some-key")
+	if !ok {
+		t.Fatal("GetHeaders did not find the entry that was just put")
+	}
+	if string(data) != "<xml/>" {
+		t.Errorf("GetHeaders returned %q, want %q", data, "<xml/>")
+	}
+}
+
+func TestCutlistCacheHeadersTTLExpiry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gool-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := newCutlistCache(dir, time.Millisecond, false)
+	c.PutHeaders("some-key", []byte("<xml/>"))
+
+	time.Sleep(10 * time.Millisecond)
+
+	if _, ok := c.GetHeaders("some-key"); ok {
+		t.Fatal("GetHeaders returned an entry older than the configured TTL")
+	}
+}
+
+func TestCutlistCacheHeadersOfflineIgnoresTTL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gool-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := newCutlistCache(dir, time.Millisecond, true)
+	c.PutHeaders("some-key", []byte("<xml/>"))
+
+	time.Sleep(10 * time.Millisecond)
+
+	if _, ok := c.GetHeaders("some-key"); !ok {
+		t.Fatal("GetHeaders rejected a stale entry even though offline mode was set")
+	}
+}
+
+func TestCutlistCacheDetailsNeverExpire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gool-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := newCutlistCache(dir, time.Millisecond, false)
+	c.PutDetails("some-id", []byte("[General]\n"))
+
+	time.Sleep(10 * time.Millisecond)
+
+	if _, ok := c.GetDetails("some-id"); !ok {
+		t.Fatal("GetDetails dropped a cutlist detail entry, but details should never expire")
+	}
+}
+
+func TestCutlistCacheChecksumMismatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gool-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := newCutlistCache(dir, 0, false)
+	c.PutDetails("some-id", []byte("[General]\n"))
+
+	if err := ioutil.WriteFile(c.detailsFile("some-id"), []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := c.GetDetails("some-id"); ok {
+		t.Fatal("GetDetails returned a tampered entry that fails its checksum")
+	}
+}
+
+// TestCutlistCachePathTraversal guards against a key/id from a CLI argument
+// or a remote server response being used to write outside the cache dir.
+func TestCutlistCachePathTraversal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gool-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	outside, err := ioutil.TempDir("", "gool-cache-outside")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+
+	c := newCutlistCache(dir, 0, false)
+	traversalKey := filepath.Join(outside, "pwned")
+
+	c.PutHeaders(traversalKey, []byte("evil"))
+
+	if _, err := os.Stat(filepath.Join(outside, "pwned.xml")); err == nil {
+		t.Fatal("PutHeaders escaped the cache directory via a path-traversal key")
+	}
+	if err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		return err
+	}); err != nil {
+		t.Fatalf("cache dir is not walkable: %v", err)
+	}
+
+	data, ok := c.GetHeaders(traversalKey)
+	if !ok || string(data) != "evil" {
+		t.Fatal("the traversal key should still resolve to a regular entry inside the cache dir")
+	}
+}
+
+// TestCutlistCacheForProviderScoping verifies that two providers sharing
+// the same video key/cutlist id don't see each other's cache entries.
+func TestCutlistCacheForProviderScoping(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gool-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	base := newCutlistCache(dir, 0, false)
+	a := base.forProvider(ProviderConfig{Type: "cutlistat", URL: "https://a.example/"})
+	b := base.forProvider(ProviderConfig{Type: "cutlistat", URL: "https://b.example/"})
+
+	a.PutDetails("42", []byte("from-a"))
+	b.PutDetails("42", []byte("from-b"))
+
+	gotA, ok := a.GetDetails("42")
+	if !ok || string(gotA) != "from-a" {
+		t.Fatalf("provider a: got %q, ok=%v, want %q", gotA, ok, "from-a")
+	}
+	gotB, ok := b.GetDetails("42")
+	if !ok || string(gotB) != "from-b" {
+		t.Fatalf("provider b: got %q, ok=%v, want %q", gotB, ok, "from-b")
+	}
+}
+
+func TestCutlistCachePruneList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gool-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := newCutlistCache(dir, time.Millisecond, false)
+	c.PutHeaders("stale", []byte("<xml/>"))
+	time.Sleep(10 * time.Millisecond)
+	c.PutHeaders("fresh", []byte("<xml/>"))
+	// the fresh entry was just written, reset its TTL clock forward so it
+	// survives the prune below while "stale" (written 10ms ago) does not.
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(c.headersFile("fresh"), future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.prune(); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+
+	entries, err := c.entries(clCacheHeadersDir)
+	if err != nil {
+		t.Fatalf("entries: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("prune left %d header entries, want 1", len(entries))
+	}
+
+	if err := c.verify(); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright (C) 2018 Michael Picht
+//
+// This file is part of gool (Online TV Recorder on Linux in Go).
+//
+// gool is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// gool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with gool. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+// cutlistprovider.go decouples cutlist retrieval from the video pipeline.
+// A CutlistProvider knows how to list cutlist headers and fetch cutlist
+// details for one source; MultiProvider fans the same request out to
+// several configured providers and merges the results, so a missing or
+// slow server no longer means "no cutlist".
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mipimipi/gool/cutlistat"
+)
+
+// CutlistProvider is implemented by anything that can serve cutlist
+// headers and cutlist details for a video key.
+type CutlistProvider interface {
+	// ListHeaders returns the cutlist headers available for key, sorted
+	// descending by score.
+	ListHeaders(key string) ([]clHeader, error)
+	// FetchDetails retrieves the cutlist identified by id.
+	FetchDetails(id string) (*cutlist, error)
+}
+
+// ProviderConfig describes one configured cutlist source. It replaces the
+// former single cfg.clsURL setting, so users can configure mirrors or
+// private cut servers in addition to the public cutlist.at instance.
+type ProviderConfig struct {
+	Type string // provider type, e.g. "cutlistat"
+	URL  string // base URL of the server, with a trailing slash
+}
+
+// newProvider creates the CutlistProvider for pc. cache is scoped to pc via
+// cutlistCache.forProvider before being handed to the provider, so that two
+// providers never share a cache slot for the same video key/cutlist id.
+// offline is passed through to providers that support caching.
+func newProvider(pc ProviderConfig, cache *cutlistCache, offline bool) (CutlistProvider, error) {
+	switch pc.Type {
+	case "cutlistat", "":
+		p := cutlistat.New(pc.URL)
+		if cache != nil {
+			p.Cache = cache.forProvider(pc)
+		}
+		p.Offline = offline
+		return &cutlistatProvider{p: p}, nil
+	default:
+		return nil, fmt.Errorf("unknown cutlist provider type '%s'", pc.Type)
+	}
+}
+
+// cutlistatProvider adapts cutlistat.Provider (which knows nothing about
+// gool's internal cutlist/clHeader types) to the CutlistProvider interface.
+type cutlistatProvider struct {
+	p *cutlistat.Provider
+}
+
+func (a *cutlistatProvider) ListHeaders(key string) ([]clHeader, error) {
+	hds, err := a.p.ListHeaders(key)
+	if err != nil {
+		return nil, err
+	}
+	clhs := make([]clHeader, len(hds))
+	for i, hd := range hds {
+		clhs[i] = clHeader{id: hd.ID, score: hd.Score}
+	}
+	sort.Sort(clHeaders(clhs))
+	return clhs, nil
+}
+
+// SubmitMeta carries the metadata a user supplies when submitting an
+// edited cutlist back to cutlist.at.
+type SubmitMeta = cutlistat.SubmitMeta
+
+// SubmitCutlist renders cl back to the cutlist.at INI schema and submits
+// it, together with meta, to the first configured cutlist.at provider. The
+// user's API token is taken from config, not from meta.
+func SubmitCutlist(cl *cutlist, meta SubmitMeta) error {
+	var pc ProviderConfig
+	for _, c := range cfg.clProviders {
+		if c.Type == "" || c.Type == "cutlistat" {
+			pc = c
+			break
+		}
+	}
+	if pc.URL == "" {
+		return fmt.Errorf("no cutlist.at provider configured to submit to")
+	}
+
+	meta.Token = cfg.clToken
+	return cutlistat.New(pc.URL).Submit(toCutlistatCutlist(cl), meta)
+}
+
+// toCutlistatCutlist converts gool's internal cutlist to cutlistat.Cutlist,
+// the inverse of cutlistatProvider.FetchDetails's conversion.
+func toCutlistatCutlist(cl *cutlist) *cutlistat.Cutlist {
+	segs := make([]*cutlistat.Seg, len(cl.segs))
+	for i, sg := range cl.segs {
+		segs[i] = &cutlistat.Seg{
+			TimeStart:  sg.timeStart,
+			TimeDur:    sg.timeDur,
+			FrameStart: sg.frameStart,
+			FrameDur:   sg.frameDur,
+		}
+	}
+	return &cutlistat.Cutlist{
+		ID:         cl.id,
+		App:        cl.app,
+		Ratio:      cl.ratio,
+		FPS:        cl.fps,
+		TimeBased:  cl.timeBased,
+		FrameBased: cl.frameBased,
+		Segs:       segs,
+	}
+}
+
+// fromCutlistatCutlist converts a cutlistat.Cutlist (e.g. one parsed from a
+// locally edited cutlist file) to gool's internal cutlist, the inverse of
+// toCutlistatCutlist.
+func fromCutlistatCutlist(cl *cutlistat.Cutlist) *cutlist {
+	segs := make([]*seg, len(cl.Segs))
+	for i, sg := range cl.Segs {
+		segs[i] = &seg{
+			timeStart:  sg.TimeStart,
+			timeDur:    sg.TimeDur,
+			frameStart: sg.FrameStart,
+			frameDur:   sg.FrameDur,
+		}
+	}
+	return &cutlist{
+		id:         cl.ID,
+		app:        cl.App,
+		ratio:      cl.Ratio,
+		fps:        cl.FPS,
+		timeBased:  cl.TimeBased,
+		frameBased: cl.FrameBased,
+		segs:       segs,
+	}
+}
+
+func (a *cutlistatProvider) FetchDetails(id string) (*cutlist, error) {
+	cl, err := a.p.FetchDetails(id)
+	if err != nil {
+		return nil, err
+	}
+	segs := make([]*seg, len(cl.Segs))
+	for i, sg := range cl.Segs {
+		segs[i] = &seg{
+			timeStart:  sg.TimeStart,
+			timeDur:    sg.TimeDur,
+			frameStart: sg.FrameStart,
+			frameDur:   sg.FrameDur,
+		}
+	}
+	return &cutlist{
+		id:         cl.ID,
+		app:        cl.App,
+		ratio:      cl.Ratio,
+		fps:        cl.FPS,
+		timeBased:  cl.TimeBased,
+		frameBased: cl.FrameBased,
+		segs:       segs,
+	}, nil
+}
+
+// MultiProvider queries an ordered list of CutlistProviders concurrently
+// and merges their headers by score, falling back across sources when one
+// of them doesn't have (or can't deliver) a cutlist.
+//
+// MultiProvider is shared across concurrently downloaded videos (gool cuts
+// several videos in parallel), so it must not keep any per-call state
+// between ListHeaders and FetchDetails - that state would race between the
+// goroutines of two videos in flight. FetchDetails therefore doesn't trust
+// anything ListHeaders saw; it simply tries every configured provider in
+// turn.
+type MultiProvider struct {
+	providers []CutlistProvider
+}
+
+// NewMultiProvider creates a MultiProvider for pcs, in the order given. cache
+// and offline are passed through to providers that support caching; cache is
+// scoped per provider by newProvider so configured sources never collide.
+func NewMultiProvider(pcs []ProviderConfig, cache *cutlistCache, offline bool) (*MultiProvider, error) {
+	mp := &MultiProvider{}
+	for _, pc := range pcs {
+		p, err := newProvider(pc, cache, offline)
+		if err != nil {
+			return nil, err
+		}
+		mp.providers = append(mp.providers, p)
+	}
+	return mp, nil
+}
+
+// ListHeaders queries all configured providers concurrently and merges
+// their headers, sorted descending by score. Providers that return an
+// error are logged and skipped - that's the whole point of having several.
+func (mp *MultiProvider) ListHeaders(key string) ([]clHeader, error) {
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		all []clHeader
+	)
+
+	for _, p := range mp.providers {
+		wg.Add(1)
+		go func(p CutlistProvider) {
+			defer wg.Done()
+			hds, err := p.ListHeaders(key)
+			if err != nil {
+				log.WithFields(log.Fields{"key": key}).Warnf("Cutlist provider could not list headers: %v", err)
+				return
+			}
+			mu.Lock()
+			all = append(all, hds...)
+			mu.Unlock()
+		}(p)
+	}
+	wg.Wait()
+
+	if len(all) == 0 {
+		return nil, nil
+	}
+
+	sort.Sort(clHeaders(all))
+
+	return all, nil
+}
+
+// FetchDetails retrieves the cutlist for id, trying each configured
+// provider in turn until one of them has it.
+func (mp *MultiProvider) FetchDetails(id string) (*cutlist, error) {
+	for _, p := range mp.providers {
+		cl, err := p.FetchDetails(id)
+		if err != nil {
+			log.Warnf("Cutlist ID=%s could not be fetched from a configured provider: %v", id, err)
+			continue
+		}
+		return cl, nil
+	}
+	return nil, fmt.Errorf("cutlist ID=%s could not be fetched from any configured provider", id)
+}
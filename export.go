@@ -0,0 +1,171 @@
+// Copyright (C) 2018 Michael Picht
+//
+// This file is part of gool (Online TV Recorder on Linux in Go).
+//
+// gool is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// gool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with gool. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+// export.go turns a *cutlist into external formats - CMX3600 EDL, an
+// ffmpeg concat demuxer script and mpv's --edl= JSON timeline - so cuts
+// acquired from a CutlistProvider can be applied in other editors or
+// previewed in mpv without going through gool's own cutter. This is the
+// boundary between "acquire cuts" (cutlist.go, cutlistprovider.go) and
+// "apply cuts" that the built-in cut pipeline otherwise bakes together.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// exportFormat identifies a supported export target for the "gool export"
+// command.
+type exportFormat string
+
+// Supported export formats.
+const (
+	exportFormatEDL    exportFormat = "edl"
+	exportFormatConcat exportFormat = "concat"
+	exportFormatMpvEDL exportFormat = "mpv-edl"
+)
+
+// export writes cl's cuts to w in format. src is the path (or URL) of the
+// source video; it is embedded in the output where the format requires a
+// reference to the source clip.
+func export(cl *cutlist, src string, format exportFormat, w io.Writer) error {
+	switch format {
+	case exportFormatEDL:
+		return exportEDL(cl, src, w)
+	case exportFormatConcat:
+		return exportConcat(cl, src, w)
+	case exportFormatMpvEDL:
+		return exportMpvEDL(cl, src, w)
+	default:
+		return fmt.Errorf("unknown export format '%s'", format)
+	}
+}
+
+// timeSpan is a cut segment expressed purely in time.
+type timeSpan struct {
+	start float64
+	dur   float64
+}
+
+// timeSpans converts cl's cuts to time spans. If cl is frame- rather than
+// time-based, times are derived from frame numbers via cl.fps - which
+// fails if cl.fps is unknown, rather than silently emitting zeroed spans.
+func (cl *cutlist) timeSpans() ([]timeSpan, error) {
+	if cl.frameBased && !cl.timeBased && cl.fps <= 0 {
+		return nil, fmt.Errorf("cannot export frame-based cutlist: unknown frame rate")
+	}
+
+	spans := make([]timeSpan, len(cl.segs))
+	for i, sg := range cl.segs {
+		switch {
+		case cl.timeBased:
+			spans[i] = timeSpan{start: sg.timeStart, dur: sg.timeDur}
+		case cl.frameBased:
+			spans[i] = timeSpan{start: float64(sg.frameStart) / cl.fps, dur: float64(sg.frameDur) / cl.fps}
+		}
+	}
+	return spans, nil
+}
+
+// timecode formats seconds as a CMX3600 HH:MM:SS:FF timecode at fps. fps
+// defaults to 25 if not set, since EDLs require a frame rate either way.
+func timecode(seconds, fps float64) string {
+	if fps <= 0 {
+		fps = 25
+	}
+
+	totalFrames := int64(seconds*fps + 0.5)
+	framesPerHour := int64(fps * 3600)
+	framesPerMinute := int64(fps * 60)
+	framesPerSecond := int64(fps)
+
+	h := totalFrames / framesPerHour
+	totalFrames %= framesPerHour
+	m := totalFrames / framesPerMinute
+	totalFrames %= framesPerMinute
+	s := totalFrames / framesPerSecond
+	f := totalFrames % framesPerSecond
+
+	return fmt.Sprintf("%02d:%02d:%02d:%02d", h, m, s, f)
+}
+
+// exportEDL writes cl's cuts as a CMX3600 EDL, one edit event per cut.
+func exportEDL(cl *cutlist, src string, w io.Writer) error {
+	spans, err := cl.timeSpans()
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "TITLE: %s\nFCM: NON-DROP FRAME\n\n", src); err != nil {
+		return err
+	}
+	for i, sp := range spans {
+		tcIn := timecode(sp.start, cl.fps)
+		tcOut := timecode(sp.start+sp.dur, cl.fps)
+		if _, err := fmt.Fprintf(w, "%03d  AX       V     C        %s %s %s %s\n", i+1, tcIn, tcOut, tcIn, tcOut); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportConcat writes cl's cuts as an ffmpeg concat demuxer script, one
+// file/inpoint/outpoint triple per cut.
+func exportConcat(cl *cutlist, src string, w io.Writer) error {
+	spans, err := cl.timeSpans()
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(w, "ffconcat version 1.0"); err != nil {
+		return err
+	}
+	for _, sp := range spans {
+		if _, err := fmt.Fprintf(w, "file '%s'\ninpoint %.3f\noutpoint %.3f\n", src, sp.start, sp.start+sp.dur); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mpvEDLPart is one entry of an mpv --edl= JSON timeline.
+type mpvEDLPart struct {
+	Source string  `json:"source"`
+	Start  float64 `json:"start"`
+	Length float64 `json:"length"`
+}
+
+// mpvEDLFile is the top-level structure of an mpv --edl= JSON timeline.
+type mpvEDLFile struct {
+	EDLVersion int          `json:"edl_version"`
+	Parts      []mpvEDLPart `json:"parts"`
+}
+
+// exportMpvEDL writes cl's cuts as an mpv --edl= JSON timeline.
+func exportMpvEDL(cl *cutlist, src string, w io.Writer) error {
+	spans, err := cl.timeSpans()
+	if err != nil {
+		return err
+	}
+	edl := mpvEDLFile{EDLVersion: 1, Parts: make([]mpvEDLPart, len(spans))}
+	for i, sp := range spans {
+		edl.Parts[i] = mpvEDLPart{Source: src, Start: sp.start, Length: sp.dur}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(edl)
+}
@@ -0,0 +1,144 @@
+// Copyright (C) 2018 Michael Picht
+//
+// This file is part of gool (Online TV Recorder on Linux in Go).
+//
+// gool is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// gool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with gool. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTimeSpansTimeBased(t *testing.T) {
+	cl := &cutlist{
+		timeBased: true,
+		segs: []*seg{
+			{timeStart: 1.5, timeDur: 2.5},
+			{timeStart: 10, timeDur: 1},
+		},
+	}
+
+	spans, err := cl.timeSpans()
+	if err != nil {
+		t.Fatalf("timeSpans: %v", err)
+	}
+	want := []timeSpan{{start: 1.5, dur: 2.5}, {start: 10, dur: 1}}
+	for i, sp := range spans {
+		if sp != want[i] {
+			t.Errorf("span %d = %+v, want %+v", i, sp, want[i])
+		}
+	}
+}
+
+func TestTimeSpansFrameBasedUsesFPS(t *testing.T) {
+	cl := &cutlist{
+		frameBased: true,
+		fps:        25,
+		segs: []*seg{
+			{frameStart: 25, frameDur: 50},
+		},
+	}
+
+	spans, err := cl.timeSpans()
+	if err != nil {
+		t.Fatalf("timeSpans: %v", err)
+	}
+	if spans[0].start != 1 || spans[0].dur != 2 {
+		t.Errorf("span = %+v, want {start:1 dur:2}", spans[0])
+	}
+}
+
+func TestTimeSpansFrameBasedWithoutFPSFails(t *testing.T) {
+	cl := &cutlist{
+		frameBased: true,
+		segs:       []*seg{{frameStart: 25, frameDur: 50}},
+	}
+
+	if _, err := cl.timeSpans(); err == nil {
+		t.Fatal("timeSpans accepted a frame-based cutlist with no frame rate")
+	}
+}
+
+func TestExportEDLPropagatesTimeSpansError(t *testing.T) {
+	cl := &cutlist{frameBased: true, segs: []*seg{{frameStart: 1, frameDur: 1}}}
+
+	var buf bytes.Buffer
+	if err := exportEDL(cl, "video.mp4", &buf); err == nil {
+		t.Fatal("exportEDL did not report the missing frame rate")
+	}
+}
+
+func TestExportEDL(t *testing.T) {
+	cl := &cutlist{
+		timeBased: true,
+		fps:       25,
+		segs:      []*seg{{timeStart: 0, timeDur: 1}},
+	}
+
+	var buf bytes.Buffer
+	if err := exportEDL(cl, "video.mp4", &buf); err != nil {
+		t.Fatalf("exportEDL: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "TITLE: video.mp4") {
+		t.Errorf("EDL output missing title: %s", out)
+	}
+	if !strings.Contains(out, "00:00:00:00 00:00:01:00") {
+		t.Errorf("EDL output missing expected timecodes: %s", out)
+	}
+}
+
+func TestExportConcat(t *testing.T) {
+	cl := &cutlist{
+		timeBased: true,
+		segs:      []*seg{{timeStart: 1, timeDur: 2}},
+	}
+
+	var buf bytes.Buffer
+	if err := exportConcat(cl, "video.mp4", &buf); err != nil {
+		t.Fatalf("exportConcat: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "file 'video.mp4'") || !strings.Contains(out, "inpoint 1.000") || !strings.Contains(out, "outpoint 3.000") {
+		t.Errorf("unexpected concat output: %s", out)
+	}
+}
+
+func TestExportMpvEDL(t *testing.T) {
+	cl := &cutlist{
+		timeBased: true,
+		segs:      []*seg{{timeStart: 1, timeDur: 2}},
+	}
+
+	var buf bytes.Buffer
+	if err := exportMpvEDL(cl, "video.mp4", &buf); err != nil {
+		t.Fatalf("exportMpvEDL: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, `"source": "video.mp4"`) || !strings.Contains(out, `"start": 1`) || !strings.Contains(out, `"length": 2`) {
+		t.Errorf("unexpected mpv-edl output: %s", out)
+	}
+}
+
+func TestExportUnknownFormat(t *testing.T) {
+	cl := &cutlist{timeBased: true, segs: []*seg{{timeStart: 0, timeDur: 1}}}
+
+	var buf bytes.Buffer
+	if err := export(cl, "video.mp4", exportFormat("bogus"), &buf); err == nil {
+		t.Fatal("export accepted an unknown format")
+	}
+}